@@ -2,8 +2,14 @@ package lexer
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"unicode"
+	"unicode/utf16"
 )
 
 type Token int
@@ -13,13 +19,18 @@ const (
 	ILLEGAL
 	IDENT
 	INT
+	FLOAT
+	STRING
+	COMMENT
 	SEMI // ;
 	COLON
+	DCOLON // ::
 
 	OPEN_BRACKET
 	CLOSE_BRACKET
 	COMMA
 	DOT
+	ELLIPSIS // ...
 	OPEN_BRACE
 	CLOSE_BRACE
 	FORWARDSLASH
@@ -33,21 +44,68 @@ const (
 	DIV // /
 	MOD // %
 
-	ASSIGN // =
+	LSS // <
+	GTR // >
+	AND // &&
+	OR  // ||
+	SHL // <<
+	SHR // >>
+
+	ASSIGN     // =
+	EQ         // ==
+	NEQ        // !=
+	LEQ        // <=
+	GEQ        // >=
+	ADD_ASSIGN // +=
+	SUB_ASSIGN // -=
+	MUL_ASSIGN // *=
+	DIV_ASSIGN // /=
+	ARROW      // ->
+
+	// Keywords
+	IF
+	ELSE
+	WHILE
+	FOR
+	FUNC
+	RETURN
+	TRUE
+	FALSE
+	NIL
 )
 
+// keywords is the default identifier-to-keyword-token mapping; each
+// Lexer gets its own copy via Keywords so callers can add or override
+// entries per instance without touching this one.
+var keywords = map[string]Token{
+	"if":     IF,
+	"else":   ELSE,
+	"while":  WHILE,
+	"for":    FOR,
+	"func":   FUNC,
+	"return": RETURN,
+	"true":   TRUE,
+	"false":  FALSE,
+	"nil":    NIL,
+}
+
 var tokens = []string{
 	EOF:     "EOF",
 	ILLEGAL: "ILLEGAL",
 	IDENT:   "IDENT",
 	INT:     "INT",
+	FLOAT:   "FLOAT",
+	STRING:  "STRING",
+	COMMENT: "COMMENT",
 	SEMI:    ";",
 	COLON:   ":",
+	DCOLON:  "::",
 
 	OPEN_BRACKET:  "OPEN_BRACKET",
 	CLOSE_BRACKET: "CLOSE_BRACKET",
 	COMMA:         "COMMA",
 	DOT:           "DOT",
+	ELLIPSIS:      "...",
 	OPEN_BRACE:    "OPEN BRACE",
 	CLOSE_BRACE:   "CLOSE BRACE",
 	FORWARDSLASH:  "FORWARDSLASH",
@@ -61,159 +119,1031 @@ var tokens = []string{
 	DIV: "/",
 	MOD: "%",
 
-	ASSIGN: "=",
+	LSS: "<",
+	GTR: ">",
+	AND: "&&",
+	OR:  "||",
+	SHL: "<<",
+	SHR: ">>",
+
+	ASSIGN:     "=",
+	EQ:         "==",
+	NEQ:        "!=",
+	LEQ:        "<=",
+	GEQ:        ">=",
+	ADD_ASSIGN: "+=",
+	SUB_ASSIGN: "-=",
+	MUL_ASSIGN: "*=",
+	DIV_ASSIGN: "/=",
+	ARROW:      "->",
+
+	IF:     "if",
+	ELSE:   "else",
+	WHILE:  "while",
+	FOR:    "for",
+	FUNC:   "func",
+	RETURN: "return",
+	TRUE:   "true",
+	FALSE:  "false",
+	NIL:    "nil",
 }
 
 func (t Token) String() string {
 	return tokens[t]
 }
 
+// Position identifies where a token or error came from. Filename is
+// only populated once SetFilename has been called on the Lexer, so
+// single-file callers can ignore it.
 type Position struct {
-	line   int
-	column int
+	Filename string
+	Line     int
+	Column   int
+}
+
+// IntLiteral carries the metadata lexNumber derives while scanning an
+// integer literal: the base it was written in and its parsed value.
+// Text is the literal exactly as it appeared in the source, digit
+// separators included; Overflow is set instead of Value when the
+// literal doesn't fit in an int64, so callers needing the full
+// magnitude have to fall back to parsing Text themselves (e.g. into a
+// big.Int).
+type IntLiteral struct {
+	Base     int
+	Text     string
+	Value    int64
+	Overflow bool
+}
+
+// LexError describes a single lexical error: where it happened, a
+// human-readable message, and the offending rune or lexeme (when
+// there's a single one worth pointing at).
+type LexError struct {
+	Position Position
+	Message  string
+	Literal  string
+}
+
+func (e *LexError) Error() string {
+	if e.Position.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.Position.Filename, e.Position.Line, e.Position.Column, e.Message)
+	}
+	return fmt.Sprintf("line %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+// tokenItem is what a StateFn emits onto the Lexer's channel; NextToken
+// and Lex both just unpack this into the classic (Position, Token, string)
+// triple.
+type tokenItem struct {
+	pos Position
+	typ Token
+	val string
+}
+
+// tokenBufferSize is how many tokens a running Lexer will buffer before
+// the producing goroutine blocks on a send.
+const tokenBufferSize = 64
+
+// StateFn represents a lexer state as a function that scans the next
+// lexeme (or fragment of one) and returns the state to run next. A nil
+// StateFn ends the run. lexStart dispatches to the States on a Lexer
+// rather than calling lexWhitespace/lexNumber/lexIdent/lexString/
+// lexOperator directly, so callers can override or extend any of them
+// to add new lexical rules without touching lexStart.
+type StateFn func(*Lexer) StateFn
+
+// States holds the StateFn lexStart dispatches to once it has
+// classified the next rune. NewLexer populates every field with the
+// package's default (lexWhitespace, lexNumber, lexIdent, lexString,
+// lexOperator); callers are free to replace any of them on a
+// per-Lexer basis, e.g. to recognize an additional numeric syntax or
+// route strings through a custom escape table.
+type States struct {
+	Whitespace StateFn
+	Number     StateFn
+	Ident      StateFn
+	String     StateFn
+	Operator   StateFn
 }
 
 type Lexer struct {
-	pos    Position
-	reader *bufio.Reader
+	pos      Position
+	prevPos  Position
+	filename string
+	reader   *bufio.Reader
+
+	// startPos is the position of the first rune of the lexeme lexStart
+	// just classified, recorded before it backs that rune up for the
+	// dispatched state function to re-read.
+	startPos Position
+
+	// EmitComments, when set, makes lexLineComment/lexBlockComment emit
+	// a COMMENT token instead of silently discarding the comment.
+	EmitComments bool
+
+	// Keywords maps identifier literals to the keyword token they
+	// should be lexed as instead of IDENT. It starts as a copy of the
+	// package's default keyword set; callers are free to add, remove,
+	// or replace entries on a per-Lexer basis.
+	Keywords map[string]Token
+
+	// States is the dispatch table lexStart consults; see StateFn.
+	States States
+
+	tokens chan tokenItem
+
+	// mu guards errs, intLiterals, curLine, and lines, which the
+	// goroutine started by Run/NextToken can still be writing to (it
+	// runs up to tokenBufferSize tokens ahead of whatever NextToken has
+	// returned) while Errors/IntLiteral/Snippet are read from another
+	// goroutine.
+	mu          sync.Mutex
+	errs        []*LexError
+	intLiterals map[Position]IntLiteral // IntLiteral recorded for every INT token, keyed by its Position
+
+	// curLine and lines back the source snippets LexError callers can
+	// render: curLine is the (possibly unterminated) line currently
+	// being scanned, lines holds every line already completed.
+	curLine        []rune
+	prevCurLineLen int
+	lines          map[int]string
 }
 
 func NewLexer(reader io.Reader) *Lexer {
+	kw := make(map[string]Token, len(keywords))
+	for lit, typ := range keywords {
+		kw[lit] = typ
+	}
+
 	return &Lexer{
-		pos:    Position{line: 1, column: 0},
-		reader: bufio.NewReader(reader),
+		pos:         Position{Line: 1, Column: 0},
+		reader:      bufio.NewReader(reader),
+		lines:       make(map[int]string),
+		intLiterals: make(map[Position]IntLiteral),
+		Keywords:    kw,
+		States: States{
+			Whitespace: lexWhitespace,
+			Number:     lexNumber,
+			Ident:      lexIdent,
+			String:     lexString,
+			Operator:   lexOperator,
+		},
 	}
 }
 
-func (l *Lexer) resetPosition() {
-	l.pos.line++
-	l.pos.column = 0
+// SetFilename attaches a filename to every Position and LexError the
+// Lexer produces from here on, so a multi-file compilation can report
+// which file a token or error came from.
+func (l *Lexer) SetFilename(name string) {
+	l.filename = name
+	l.pos.Filename = name
+}
+
+// Errors returns every LexError recorded so far, in the order they were
+// encountered. Safe to call while a Run goroutine is still draining
+// tokens through NextToken.
+func (l *Lexer) Errors() []*LexError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.errs
+}
+
+// IntLiteral returns the base/value metadata recorded for the INT
+// token emitted at pos, if one was scanned there. Safe to call while a
+// Run goroutine is still draining tokens through NextToken.
+func (l *Lexer) IntLiteral(pos Position) (IntLiteral, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, ok := l.intLiterals[pos]
+	return v, ok
 }
 
+// Snippet renders a LexError as a caret-underlined view of the source
+// line it occurred on, e.g.:
+//
+//	line 3:5: unexpected '@'
+//	  foo @ bar
+//	      ^
+func (l *Lexer) Snippet(err *LexError) string {
+	l.mu.Lock()
+	line, ok := l.lines[err.Position.Line]
+	if !ok {
+		line = string(l.curLine)
+	}
+	l.mu.Unlock()
+
+	col := err.Position.Column
+	if col < 1 {
+		col = 1
+	}
+
+	caret := strings.Repeat(" ", col-1) + "^"
+	return fmt.Sprintf("%s\n  %s\n  %s", err.Error(), line, caret)
+}
+
+// addError appends err to l.errs under l.mu, since the producing
+// goroutine can still be running (and recording further errors) while
+// Errors is read from another goroutine.
+func (l *Lexer) addError(err *LexError) {
+	l.mu.Lock()
+	l.errs = append(l.errs, err)
+	l.mu.Unlock()
+}
+
+// illegal records a LexError at pos and emits the matching ILLEGAL
+// token. literal, when non-empty, is both the LexError's offending
+// lexeme and the token's value; otherwise the token carries message
+// (there being no single lexeme to point at, e.g. an unterminated
+// string).
+func (l *Lexer) illegal(pos Position, literal, message string) {
+	l.addError(&LexError{Position: pos, Message: message, Literal: literal})
+
+	val := literal
+	if val == "" {
+		val = message
+	}
+	l.emit(pos, ILLEGAL, val)
+}
+
+// ioErrorState records a read error from the underlying reader and
+// halts the state machine. In practice this only fires when the
+// io.Reader backing the Lexer is broken, since EOF is handled
+// separately.
+func (l *Lexer) ioErrorState(err error) StateFn {
+	l.addError(&LexError{Position: l.pos, Message: fmt.Sprintf("read error: %v", err)})
+	l.emit(l.pos, EOF, "")
+	return nil
+}
+
+// Run starts the lexer's state machine on its own goroutine, beginning
+// at lexStart. Tokens become available through NextToken as soon as
+// they're emitted; the goroutine exits once the input is drained and
+// closes the token channel. Run must only be called once per Lexer.
+func (l *Lexer) Run() {
+	l.tokens = make(chan tokenItem, tokenBufferSize)
+	go l.loop()
+}
+
+func (l *Lexer) loop() {
+	for state := StateFn(lexStart); state != nil; {
+		state = state(l)
+	}
+	close(l.tokens)
+}
+
+// emit sends a scanned token to whoever is draining NextToken.
+func (l *Lexer) emit(pos Position, typ Token, val string) {
+	l.tokens <- tokenItem{pos: pos, typ: typ, val: val}
+}
+
+// NextToken blocks until the running state machine has a token ready,
+// starting the machine via Run if it hasn't been started yet. Once the
+// input is exhausted it keeps returning EOF, matching Lex's behavior.
+func (l *Lexer) NextToken() (Position, Token, string) {
+	if l.tokens == nil {
+		l.Run()
+	}
+
+	item, ok := <-l.tokens
+	if !ok {
+		return l.pos, EOF, ""
+	}
+	return item.pos, item.typ, item.val
+}
+
+// Lex scans and returns the next token synchronously. It is kept for
+// backwards compatibility and is now just a thin wrapper around the
+// channel-based state machine driven by Run/NextToken. Lexical errors
+// don't stop Lex from returning tokens (it still hands back ILLEGAL
+// tokens as before) but are also recorded and available via Errors.
 func (l *Lexer) Lex() (Position, Token, string) {
-	// keep looping until we return a token
+	return l.NextToken()
+}
+
+// readRune reads the next rune, advancing position bookkeeping and the
+// per-line cache used for error snippets. The single most recently
+// returned rune can be undone with backup.
+func (l *Lexer) readRune() (rune, error) {
+	r, _, err := l.reader.ReadRune()
+	if err != nil {
+		return r, err
+	}
+
+	l.prevPos = l.pos
+	if r == '\n' {
+		l.mu.Lock()
+		l.lines[l.pos.Line] = string(l.curLine)
+		l.prevCurLineLen = len(l.curLine)
+		l.curLine = l.curLine[:0]
+		l.mu.Unlock()
+		l.pos.Line++
+		l.pos.Column = 0
+	} else {
+		l.pos.Column++
+		l.mu.Lock()
+		l.curLine = append(l.curLine, r)
+		l.mu.Unlock()
+	}
+
+	return r, nil
+}
+
+// backup undoes the single most recently read rune so it can be
+// rescanned, e.g. when a state function reads one rune past its lexeme
+// to find where it ends.
+func (l *Lexer) backup() {
+	if err := l.reader.UnreadRune(); err != nil {
+		l.addError(&LexError{Position: l.pos, Message: fmt.Sprintf("internal lexer error: %v", err)})
+		return
+	}
+
+	l.mu.Lock()
+	if l.pos.Line != l.prevPos.Line {
+		l.curLine = l.curLine[:l.prevCurLineLen]
+	} else if len(l.curLine) > 0 {
+		l.curLine = l.curLine[:len(l.curLine)-1]
+	}
+	l.mu.Unlock()
+	l.pos = l.prevPos
+}
+
+// peek returns the next rune without consuming it, or (0, false) at
+// EOF. It's the lookahead lexOperator uses to tell compound operators
+// and comments apart from their single-character prefixes.
+func (l *Lexer) peek() (rune, bool) {
+	r, _, err := l.reader.ReadRune()
+	if err != nil {
+		return 0, false
+	}
+	l.reader.UnreadRune()
+	return r, true
+}
+
+// consumeIf consumes and reports whether the next rune equals want,
+// leaving the reader untouched when it doesn't.
+func (l *Lexer) consumeIf(want rune) bool {
+	r, ok := l.peek()
+	if !ok || r != want {
+		return false
+	}
+	l.readRune()
+	return true
+}
+
+// lexStart dispatches on the next rune to decide which state should
+// scan the upcoming lexeme, consulting l.States rather than calling
+// lexWhitespace/lexNumber/lexIdent/lexString/lexOperator directly so
+// callers can override or extend any of them.
+func lexStart(l *Lexer) StateFn {
+	r, err := l.readRune()
+	if err != nil {
+		if err == io.EOF {
+			l.emit(l.pos, EOF, "")
+			return nil
+		}
+		return l.ioErrorState(err)
+	}
+	l.startPos = l.pos
+
+	switch {
+	case r == '\n':
+		return lexStart
+	case unicode.IsSpace(r):
+		l.backup()
+		return l.States.Whitespace
+	case unicode.IsDigit(r):
+		l.backup()
+		return l.States.Number
+	case unicode.IsLetter(r) || r == '_':
+		l.backup()
+		return l.States.Ident
+	case r == '"' || r == '\'':
+		l.backup()
+		return l.States.String
+	default:
+		l.backup()
+		return l.States.Operator
+	}
+}
+
+// lexWhitespace consumes a run of whitespace without emitting anything.
+func lexWhitespace(l *Lexer) StateFn {
 	for {
-		r, _, err := l.reader.ReadRune()
+		r, err := l.readRune()
 		if err != nil {
 			if err == io.EOF {
-				return l.pos, EOF, ""
+				return lexStart
 			}
+			return l.ioErrorState(err)
+		}
 
-			// at this point there isn't much we can do, and the compiler
-			// should just return the raw error to the user
-			panic(err)
-		}
-
-		l.pos.column++
-
-		switch r {
-		case '\n':
-			l.resetPosition()
-		case ';':
-			return l.pos, SEMI, ";"
-		case ':':
-			return l.pos, COLON, ":"
-		case '+':
-			return l.pos, ADD, "+"
-		case '-':
-			return l.pos, SUB, "-"
-		case '*':
-			return l.pos, MUL, "*"
-		case '/':
-			return l.pos, DIV, "/"
-		case '%':
-			return l.pos, MOD, "%"
-		case '=':
-			return l.pos, ASSIGN, "="
-		case '(':
-			return l.pos, OPEN_BRACKET, "("
-		case ')':
-			return l.pos, CLOSE_BRACKET, ")"
-		case ',':
-			return l.pos, COMMA, ","
-		case '.':
-			return l.pos, DOT, "."
-		case '{':
-			return l.pos, OPEN_BRACE, "{"
-		case '}':
-			return l.pos, CLOSE_BRACE, "}"
-
-		case '\\':
-			return l.pos, FORWARDSLASH, "\\"
-		case '"':
-			return l.pos, DOUBLEQUOTE, `"`
-		case '\'':
-			return l.pos, SINGLEQUOTE, "'"
-		default:
-			if unicode.IsSpace(r) {
-				continue // nothing to do here, just move on
-			} else if unicode.IsDigit(r) {
-				// backup and let lexInt rescan the beginning of the int
-				startPos := l.pos
-				l.backup()
-				lit := l.lexInt()
-				return startPos, INT, lit
-			} else if unicode.IsLetter(r) {
-				// backup and let lexIdent rescan the beginning of the ident
-				startPos := l.pos
+		if r != '\n' && !unicode.IsSpace(r) {
+			l.backup()
+			return lexStart
+		}
+	}
+}
+
+// lexNumber scans an INT or FLOAT literal. A "0x"/"0X", "0o"/"0O", or
+// "0b"/"0B" prefix switches to hex, octal, or binary digits (no
+// fraction/exponent follows those); otherwise it's a decimal run,
+// promoted to FLOAT if a fractional part and/or exponent follows. `_`
+// is allowed as a digit separator in any base, matching Go. Malformed
+// digit runs (e.g. "0x", "0b2", "1__2") are emitted as ILLEGAL, and
+// integers too large for an int64 are flagged via IntLiteral.Overflow
+// rather than causing a panic.
+func lexNumber(l *Lexer) StateFn {
+	startPos := l.startPos
+
+	if base, prefix, ok := l.peekBasePrefix(); ok {
+		l.readRune()
+		l.readRune()
+
+		digits, malformed := l.scanDigitRun(base)
+		text := prefix + digits
+		if malformed != "" {
+			l.illegal(startPos, text, malformed)
+			return lexStart
+		}
+
+		l.emitInt(startPos, text, base, digits)
+		return lexStart
+	}
+
+	digits, malformed := l.scanDigitRun(10)
+	if malformed != "" {
+		l.illegal(startPos, digits, malformed)
+		return lexStart
+	}
+
+	lit := digits
+	typ := Token(INT)
+
+	if frac, ok := l.scanFraction(); ok {
+		lit += frac
+		typ = FLOAT
+	}
+
+	if exp, ok := l.scanExponent(); ok {
+		lit += exp
+		typ = FLOAT
+	}
+
+	if typ == FLOAT {
+		l.emit(startPos, FLOAT, lit)
+	} else {
+		l.emitInt(startPos, lit, 10, digits)
+	}
+	return lexStart
+}
+
+// peekBasePrefix reports whether the reader is positioned at a "0x",
+// "0o", or "0b" base prefix (in either case) without consuming it.
+func (l *Lexer) peekBasePrefix() (base int, prefix string, ok bool) {
+	b, err := l.reader.Peek(2)
+	if err != nil || len(b) < 2 || b[0] != '0' {
+		return 0, "", false
+	}
+
+	switch b[1] {
+	case 'x', 'X':
+		return 16, string(b[:2]), true
+	case 'o', 'O':
+		return 8, string(b[:2]), true
+	case 'b', 'B':
+		return 2, string(b[:2]), true
+	default:
+		return 0, "", false
+	}
+}
+
+// scanDigitRun consumes a run of digits valid for base, allowing `_` as
+// a separator between digits. It returns the literal exactly as
+// written (separators included) and a non-empty description if the run
+// is empty, starts/ends with '_', or doubles up a separator.
+func (l *Lexer) scanDigitRun(base int) (string, string) {
+	var lit strings.Builder
+	sawDigit := false
+	lastWasSeparator := false
+
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			break
+		}
+
+		if r == '_' {
+			if !sawDigit || lastWasSeparator {
 				l.backup()
-				lit := l.lexIdent()
-				return startPos, IDENT, lit
-			} else {
-				return l.pos, ILLEGAL, string(r)
+				return lit.String(), "malformed number literal: unexpected '_'"
 			}
+			lastWasSeparator = true
+			lit.WriteRune(r)
+			continue
+		}
+
+		if _, ok := digitValue(r, base); !ok {
+			l.backup()
+			break
 		}
+
+		sawDigit = true
+		lastWasSeparator = false
+		lit.WriteRune(r)
+	}
+
+	switch {
+	case lastWasSeparator:
+		return lit.String(), "malformed number literal: trailing '_'"
+	case !sawDigit:
+		return lit.String(), "malformed number literal: expected at least one digit"
+	default:
+		return lit.String(), ""
 	}
 }
 
-func (l *Lexer) backup() {
-	if err := l.reader.UnreadRune(); err != nil {
-		panic(err)
+func digitValue(r rune, base int) (int, bool) {
+	v, ok := hexDigitValue(r)
+	if !ok || int(v) >= base {
+		return 0, false
 	}
+	return int(v), true
+}
+
+// emitInt emits an INT token and records its IntLiteral metadata.
+func (l *Lexer) emitInt(pos Position, text string, base int, digits string) {
+	value, overflow := parseIntLiteral(digits, base)
 
-	l.pos.column--
+	l.mu.Lock()
+	l.intLiterals[pos] = IntLiteral{Base: base, Text: text, Value: value, Overflow: overflow}
+	l.mu.Unlock()
+
+	l.emit(pos, INT, text)
 }
 
-func (l *Lexer) lexInt() string {
-	var lit string
+// parseIntLiteral parses digits (with any `_` separators stripped) as
+// a base-N integer, reporting overflow instead of an error when it
+// doesn't fit in an int64.
+func parseIntLiteral(digits string, base int) (value int64, overflow bool) {
+	clean := strings.ReplaceAll(digits, "_", "")
+	u, err := strconv.ParseUint(clean, base, 64)
+	if err != nil || u > math.MaxInt64 {
+		return 0, true
+	}
+	return int64(u), false
+}
+
+// scanFraction consumes a '.' followed by one or more digits, e.g. the
+// ".25" in "3.25". If the '.' isn't followed by a digit it is left
+// unconsumed so it can still be lexed as DOT.
+func (l *Lexer) scanFraction() (string, bool) {
+	b, err := l.reader.Peek(2)
+	if err != nil || len(b) < 2 || b[0] != '.' || !isASCIIDigit(rune(b[1])) {
+		return "", false
+	}
+
+	r, _ := l.readRune()
+	lit := string(r)
+
 	for {
-		r, _, err := l.reader.ReadRune()
+		r, err := l.readRune()
 		if err != nil {
-			if err == io.EOF {
-				// at the end of the int
-				return lit
-			}
+			break
 		}
+		if unicode.IsDigit(r) {
+			lit += string(r)
+		} else {
+			l.backup()
+			break
+		}
+	}
+
+	return lit, true
+}
 
-		l.pos.column++
+// scanExponent consumes an 'e'/'E' exponent marker, an optional sign,
+// and its digits, e.g. the "e-10" in "3e-10". If no digits follow the
+// marker (and optional sign) nothing is consumed.
+func (l *Lexer) scanExponent() (string, bool) {
+	b, err := l.reader.Peek(1)
+	if err != nil || (b[0] != 'e' && b[0] != 'E') {
+		return "", false
+	}
+
+	digitsAt := 1
+	if b2, err := l.reader.Peek(2); err == nil && len(b2) == 2 && (b2[1] == '+' || b2[1] == '-') {
+		digitsAt = 2
+	}
+	b3, err := l.reader.Peek(digitsAt + 1)
+	if err != nil || len(b3) < digitsAt+1 || !isASCIIDigit(rune(b3[digitsAt])) {
+		return "", false
+	}
+
+	r, _ := l.readRune()
+	lit := string(r)
+
+	if digitsAt == 2 {
+		sign, _ := l.readRune()
+		lit += string(sign)
+	}
+
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			break
+		}
 		if unicode.IsDigit(r) {
-			lit = lit + string(r)
+			lit += string(r)
 		} else {
-			// scanned something not in the integer
 			l.backup()
-			return lit
+			break
 		}
 	}
+
+	return lit, true
 }
 
-func (l *Lexer) lexIdent() string {
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// lexIdent scans a run of letters, digits, and underscores (the first
+// rune having already been confirmed a letter or underscore) into an
+// IDENT token, or one of the Lexer's Keywords tokens if the literal
+// matches.
+func lexIdent(l *Lexer) StateFn {
+	startPos := l.startPos
 	var lit string
 	for {
-		r, _, err := l.reader.ReadRune()
+		r, err := l.readRune()
 		if err != nil {
-			if err == io.EOF {
-				// at the end of the identifier
-				return lit
-			}
+			break
 		}
 
-		l.pos.column++
-		if unicode.IsLetter(r) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
 			lit = lit + string(r)
 		} else {
-			// scanned something not in the identifier
 			l.backup()
-			return lit
+			break
 		}
 	}
+
+	typ := Token(IDENT)
+	if kw, ok := l.Keywords[lit]; ok {
+		typ = kw
+	}
+
+	l.emit(startPos, typ, lit)
+	return lexStart
+}
+
+// lexString scans a "..." or '...' literal, processing escape sequences
+// along the way, and emits the decoded contents as a single STRING
+// token. Unterminated literals and invalid escapes are emitted (and
+// recorded via Errors) as ILLEGAL instead.
+func lexString(l *Lexer) StateFn {
+	startPos := l.startPos
+	quote, err := l.readRune()
+	if err != nil {
+		return l.ioErrorState(err)
+	}
+
+	var sb strings.Builder
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			l.illegal(startPos, "", "unterminated string literal")
+			return lexStart
+		}
+
+		if r == '\n' {
+			l.backup()
+			l.illegal(startPos, "", "unterminated string literal")
+			return lexStart
+		}
+
+		if r == quote {
+			l.emit(startPos, STRING, sb.String())
+			return lexStart
+		}
+
+		if r != '\\' {
+			sb.WriteRune(r)
+			continue
+		}
+
+		if err := l.scanEscape(&sb); err != nil {
+			l.illegal(startPos, "", err.Error())
+			return lexStart
+		}
+	}
+}
+
+// scanEscape reads the rune(s) following a '\' already consumed by the
+// caller and writes the decoded value to sb.
+func (l *Lexer) scanEscape(sb *strings.Builder) error {
+	r, err := l.readRune()
+	if err != nil {
+		return fmt.Errorf("unterminated escape sequence")
+	}
+
+	switch r {
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case '\\':
+		sb.WriteByte('\\')
+	case '"':
+		sb.WriteByte('"')
+	case '\'':
+		sb.WriteByte('\'')
+	case 'x':
+		v, err := l.scanHexDigits(2)
+		if err != nil {
+			return err
+		}
+		sb.WriteByte(byte(v))
+	case 'u':
+		return l.scanUnicodeEscape(sb)
+	case 'U':
+		v, err := l.scanHexDigits(8)
+		if err != nil {
+			return err
+		}
+		sb.WriteRune(rune(v))
+	default:
+		return fmt.Errorf("unknown escape sequence '\\%c'", r)
+	}
+
+	return nil
+}
+
+// scanUnicodeEscape handles a \uNNNN escape already past the 'u',
+// combining it with a following \uNNNN low surrogate when the first
+// one decodes to a UTF-16 high surrogate. A lone low surrogate is
+// rejected outright, since it can never stand on its own.
+func (l *Lexer) scanUnicodeEscape(sb *strings.Builder) error {
+	hi, err := l.scanHexDigits(4)
+	if err != nil {
+		return err
+	}
+
+	r := rune(hi)
+	if !utf16.IsSurrogate(r) {
+		sb.WriteRune(r)
+		return nil
+	}
+	if !isHighSurrogate(r) {
+		return fmt.Errorf("unpaired UTF-16 surrogate \\u%04x", hi)
+	}
+
+	b, err := l.reader.Peek(2)
+	if err != nil || b[0] != '\\' || b[1] != 'u' {
+		return fmt.Errorf("unpaired UTF-16 surrogate \\u%04x", hi)
+	}
+	if _, err := l.readRune(); err != nil { // consume '\\'
+		return fmt.Errorf("unterminated escape sequence")
+	}
+	if _, err := l.readRune(); err != nil { // consume 'u'
+		return fmt.Errorf("unterminated escape sequence")
+	}
+
+	lo, err := l.scanHexDigits(4)
+	if err != nil {
+		return err
+	}
+
+	decoded := utf16.DecodeRune(r, rune(lo))
+	if decoded == unicode.ReplacementChar {
+		return fmt.Errorf("invalid UTF-16 surrogate pair \\u%04x\\u%04x", hi, lo)
+	}
+	sb.WriteRune(decoded)
+	return nil
+}
+
+// scanHexDigits reads exactly n hex digits and returns their value.
+func (l *Lexer) scanHexDigits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		r, err := l.readRune()
+		if err != nil {
+			return 0, fmt.Errorf("invalid hex escape: unexpected end of input")
+		}
+
+		d, ok := hexDigitValue(r)
+		if !ok {
+			return 0, fmt.Errorf("invalid hex escape: %q is not a hex digit", r)
+		}
+		v = v<<4 | uint32(d)
+	}
+	return v, nil
+}
+
+// isHighSurrogate reports whether r is a UTF-16 high surrogate, the only
+// half of a surrogate pair that can legally open one. A low surrogate
+// can only ever appear as the second half of a pair started by a high
+// surrogate, never on its own.
+func isHighSurrogate(r rune) bool {
+	return r >= 0xD800 && r <= 0xDBFF
+}
+
+func hexDigitValue(r rune) (uint32, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return uint32(r - '0'), true
+	case r >= 'a' && r <= 'f':
+		return uint32(r-'a') + 10, true
+	case r >= 'A' && r <= 'F':
+		return uint32(r-'A') + 10, true
+	default:
+		return 0, false
+	}
+}
+
+// lexOperator scans a punctuation/operator rune, combining it with a
+// following rune into a compound operator (or a comment, for '/') when
+// one applies.
+func lexOperator(l *Lexer) StateFn {
+	startPos := l.startPos
+	r, err := l.readRune()
+	if err != nil {
+		return l.ioErrorState(err)
+	}
+
+	switch r {
+	case ';':
+		l.emit(startPos, SEMI, ";")
+	case ':':
+		if l.consumeIf(':') {
+			l.emit(startPos, DCOLON, "::")
+		} else {
+			l.emit(startPos, COLON, ":")
+		}
+	case '+':
+		if l.consumeIf('=') {
+			l.emit(startPos, ADD_ASSIGN, "+=")
+		} else {
+			l.emit(startPos, ADD, "+")
+		}
+	case '-':
+		switch {
+		case l.consumeIf('='):
+			l.emit(startPos, SUB_ASSIGN, "-=")
+		case l.consumeIf('>'):
+			l.emit(startPos, ARROW, "->")
+		default:
+			l.emit(startPos, SUB, "-")
+		}
+	case '*':
+		if l.consumeIf('=') {
+			l.emit(startPos, MUL_ASSIGN, "*=")
+		} else {
+			l.emit(startPos, MUL, "*")
+		}
+	case '/':
+		switch next, ok := l.peek(); {
+		case ok && next == '/':
+			return lexLineComment
+		case ok && next == '*':
+			return lexBlockComment
+		case l.consumeIf('='):
+			l.emit(startPos, DIV_ASSIGN, "/=")
+		default:
+			l.emit(startPos, DIV, "/")
+		}
+	case '%':
+		l.emit(startPos, MOD, "%")
+	case '=':
+		if l.consumeIf('=') {
+			l.emit(startPos, EQ, "==")
+		} else {
+			l.emit(startPos, ASSIGN, "=")
+		}
+	case '!':
+		if l.consumeIf('=') {
+			l.emit(startPos, NEQ, "!=")
+		} else {
+			l.illegal(startPos, "!", "unexpected character '!'")
+		}
+	case '<':
+		switch {
+		case l.consumeIf('='):
+			l.emit(startPos, LEQ, "<=")
+		case l.consumeIf('<'):
+			l.emit(startPos, SHL, "<<")
+		default:
+			l.emit(startPos, LSS, "<")
+		}
+	case '>':
+		switch {
+		case l.consumeIf('='):
+			l.emit(startPos, GEQ, ">=")
+		case l.consumeIf('>'):
+			l.emit(startPos, SHR, ">>")
+		default:
+			l.emit(startPos, GTR, ">")
+		}
+	case '&':
+		if l.consumeIf('&') {
+			l.emit(startPos, AND, "&&")
+		} else {
+			l.illegal(startPos, "&", "unexpected character '&'")
+		}
+	case '|':
+		if l.consumeIf('|') {
+			l.emit(startPos, OR, "||")
+		} else {
+			l.illegal(startPos, "|", "unexpected character '|'")
+		}
+	case '(':
+		l.emit(startPos, OPEN_BRACKET, "(")
+	case ')':
+		l.emit(startPos, CLOSE_BRACKET, ")")
+	case ',':
+		l.emit(startPos, COMMA, ",")
+	case '.':
+		if l.consumeIf('.') {
+			if l.consumeIf('.') {
+				l.emit(startPos, ELLIPSIS, "...")
+			} else {
+				l.illegal(startPos, "..", "unexpected \"..\"")
+			}
+		} else {
+			l.emit(startPos, DOT, ".")
+		}
+	case '{':
+		l.emit(startPos, OPEN_BRACE, "{")
+	case '}':
+		l.emit(startPos, CLOSE_BRACE, "}")
+	case '\\':
+		l.emit(startPos, FORWARDSLASH, "\\")
+	default:
+		l.illegal(startPos, string(r), fmt.Sprintf("unexpected character %q", r))
+	}
+
+	return lexStart
+}
+
+// lexLineComment consumes a "//" comment up to (but not including) the
+// terminating newline or EOF, emitting a COMMENT token when
+// EmitComments is set.
+func lexLineComment(l *Lexer) StateFn {
+	startPos := l.pos
+	l.readRune() // consume the second '/'
+
+	var lit strings.Builder
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			break
+		}
+		if r == '\n' {
+			l.backup()
+			break
+		}
+		lit.WriteRune(r)
+	}
+
+	if l.EmitComments {
+		l.emit(startPos, COMMENT, "//"+lit.String())
+	}
+	return lexStart
+}
+
+// lexBlockComment consumes a "/* ... */" comment, supporting nested
+// block comments, emitting a COMMENT token when EmitComments is set.
+// An unterminated block comment is emitted as ILLEGAL.
+func lexBlockComment(l *Lexer) StateFn {
+	startPos := l.pos
+	l.readRune() // consume the '*'
+
+	var lit strings.Builder
+	for depth := 1; depth > 0; {
+		r, err := l.readRune()
+		if err != nil {
+			l.illegal(startPos, "", "unterminated block comment")
+			return lexStart
+		}
+
+		switch {
+		case r == '/' && l.consumeIf('*'):
+			depth++
+			lit.WriteString("/*")
+		case r == '*' && l.consumeIf('/'):
+			depth--
+			if depth > 0 {
+				lit.WriteString("*/")
+			}
+		default:
+			lit.WriteRune(r)
+		}
+	}
+
+	if l.EmitComments {
+		l.emit(startPos, COMMENT, "/*"+lit.String()+"*/")
+	}
+	return lexStart
 }
@@ -0,0 +1,304 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+// scanAll drains a Lexer into its token stream, stopping at (and
+// including) EOF, so tests can assert on the whole sequence at once.
+func scanAll(src string) []tokenItem {
+	l := NewLexer(strings.NewReader(src))
+	var toks []tokenItem
+	for {
+		pos, typ, lit := l.NextToken()
+		toks = append(toks, tokenItem{pos: pos, typ: typ, val: lit})
+		if typ == EOF {
+			return toks
+		}
+	}
+}
+
+func TestLexNumberBases(t *testing.T) {
+	tests := []struct {
+		src  string
+		base int
+		text string
+	}{
+		{"0x1A", 16, "0x1A"},
+		{"0o17", 8, "0o17"},
+		{"0b101", 2, "0b101"},
+		{"42", 10, "42"},
+		{"1_000_000", 10, "1_000_000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			l := NewLexer(strings.NewReader(tt.src))
+			pos, typ, lit := l.NextToken()
+			if typ != INT {
+				t.Fatalf("got token %v %q, want INT", typ, lit)
+			}
+			if lit != tt.text {
+				t.Fatalf("got literal %q, want %q", lit, tt.text)
+			}
+
+			il, ok := l.IntLiteral(pos)
+			if !ok {
+				t.Fatalf("no IntLiteral recorded at %+v", pos)
+			}
+			if il.Base != tt.base {
+				t.Fatalf("got base %d, want %d", il.Base, tt.base)
+			}
+			if il.Overflow {
+				t.Fatalf("unexpected overflow for %q", tt.src)
+			}
+		})
+	}
+}
+
+func TestLexNumberOverflow(t *testing.T) {
+	l := NewLexer(strings.NewReader("99999999999999999999"))
+	pos, typ, lit := l.NextToken()
+	if typ != INT {
+		t.Fatalf("got token %v %q, want INT", typ, lit)
+	}
+
+	il, ok := l.IntLiteral(pos)
+	if !ok {
+		t.Fatalf("no IntLiteral recorded at %+v", pos)
+	}
+	if !il.Overflow {
+		t.Fatalf("expected overflow for %q", lit)
+	}
+}
+
+func TestLexNumberMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"leading separator", "0x_1"},
+		{"trailing separator", "1_"},
+		{"doubled separator", "1__2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLexer(strings.NewReader(tt.src))
+			_, typ, lit := l.NextToken()
+			if typ != ILLEGAL {
+				t.Fatalf("got token %v %q, want ILLEGAL", typ, lit)
+			}
+			if len(l.Errors()) != 1 {
+				t.Fatalf("got %d errors, want 1", len(l.Errors()))
+			}
+		})
+	}
+}
+
+func TestLexStringEscapes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\nb"`, "a\nb"},
+		{`"\x41"`, "A"},
+		{`"A"`, "A"},
+		{`"\U0001F600"`, "\U0001F600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			l := NewLexer(strings.NewReader(tt.src))
+			_, typ, lit := l.NextToken()
+			if typ != STRING {
+				t.Fatalf("got token %v %q, want STRING", typ, lit)
+			}
+			if lit != tt.want {
+				t.Fatalf("got %q, want %q", lit, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexStringSurrogatePair(t *testing.T) {
+	l := NewLexer(strings.NewReader(`"😀"`))
+	_, typ, lit := l.NextToken()
+	if typ != STRING {
+		t.Fatalf("got token %v %q, want STRING", typ, lit)
+	}
+	if lit != "\U0001F600" {
+		t.Fatalf("got %q, want U+1F600", lit)
+	}
+}
+
+func TestLexStringLoneLowSurrogate(t *testing.T) {
+	// A lone low surrogate must be rejected outright, without consuming
+	// (and so discarding) whatever escape follows it.
+	toks := scanAll(`"\uDC00Arest"`)
+
+	if toks[0].typ != ILLEGAL {
+		t.Fatalf("got token %v %q, want ILLEGAL", toks[0].typ, toks[0].val)
+	}
+
+	var sawIdent bool
+	for _, tok := range toks[1:] {
+		if tok.typ == IDENT && tok.val == "Arest" {
+			sawIdent = true
+		}
+	}
+	if !sawIdent {
+		t.Fatalf("escape after lone low surrogate was consumed instead of left for the next token: %+v", toks)
+	}
+}
+
+func TestLexStringUnpairedHighSurrogate(t *testing.T) {
+	l := NewLexer(strings.NewReader(`"\uD800"`))
+	_, typ, lit := l.NextToken()
+	if typ != ILLEGAL {
+		t.Fatalf("got token %v %q, want ILLEGAL", typ, lit)
+	}
+}
+
+func TestLexCompoundOperators(t *testing.T) {
+	tests := []struct {
+		src  string
+		typ  Token
+		want string
+	}{
+		{"::", DCOLON, "::"},
+		{"+=", ADD_ASSIGN, "+="},
+		{"->", ARROW, "->"},
+		{"==", EQ, "=="},
+		{"!=", NEQ, "!="},
+		{"<=", LEQ, "<="},
+		{">=", GEQ, ">="},
+		{"&&", AND, "&&"},
+		{"||", OR, "||"},
+		{"<<", SHL, "<<"},
+		{">>", SHR, ">>"},
+		{"...", ELLIPSIS, "..."},
+		// Single-character prefixes must still lex on their own when the
+		// following rune doesn't complete a compound operator.
+		{"+", ADD, "+"},
+		{"<", LSS, "<"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			l := NewLexer(strings.NewReader(tt.src))
+			_, typ, lit := l.NextToken()
+			if typ != tt.typ {
+				t.Fatalf("got token %v %q, want %v", typ, lit, tt.typ)
+			}
+			if lit != tt.want {
+				t.Fatalf("got literal %q, want %q", lit, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexLineCommentSkipped(t *testing.T) {
+	toks := scanAll("x // trailing comment\ny")
+
+	var got []Token
+	for _, tok := range toks {
+		got = append(got, tok.typ)
+	}
+	want := []Token{IDENT, IDENT, EOF}
+	if len(got) != len(want) {
+		t.Fatalf("got tokens %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got tokens %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLexLineCommentEmitted(t *testing.T) {
+	l := NewLexer(strings.NewReader("// hello\n"))
+	l.EmitComments = true
+
+	_, typ, lit := l.NextToken()
+	if typ != COMMENT {
+		t.Fatalf("got token %v %q, want COMMENT", typ, lit)
+	}
+	if lit != "// hello" {
+		t.Fatalf("got literal %q, want %q", lit, "// hello")
+	}
+}
+
+func TestLexBlockCommentNested(t *testing.T) {
+	toks := scanAll("/* outer /* inner */ still outer */x")
+
+	if len(toks) != 2 {
+		t.Fatalf("got %d tokens, want 2 (IDENT, EOF): %+v", len(toks), toks)
+	}
+	if toks[0].typ != IDENT || toks[0].val != "x" {
+		t.Fatalf("got %+v, want IDENT %q", toks[0], "x")
+	}
+}
+
+func TestLexKeywordVsIdent(t *testing.T) {
+	tests := []struct {
+		src string
+		typ Token
+	}{
+		{"if", IF},
+		{"else", ELSE},
+		{"while", WHILE},
+		{"for", FOR},
+		{"func", FUNC},
+		{"return", RETURN},
+		{"true", TRUE},
+		{"false", FALSE},
+		{"nil", NIL},
+		{"iffy", IDENT},
+		{"forEach", IDENT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			l := NewLexer(strings.NewReader(tt.src))
+			_, typ, lit := l.NextToken()
+			if typ != tt.typ {
+				t.Fatalf("got token %v %q, want %v", typ, lit, tt.typ)
+			}
+		})
+	}
+}
+
+func TestRunNextTokenDrainToEOF(t *testing.T) {
+	l := NewLexer(strings.NewReader("x = 1 @ true"))
+	l.Run()
+
+	var got []Token
+	for {
+		_, typ, _ := l.NextToken()
+		got = append(got, typ)
+		if typ == EOF {
+			break
+		}
+	}
+
+	want := []Token{IDENT, ASSIGN, INT, ILLEGAL, TRUE, EOF}
+	if len(got) != len(want) {
+		t.Fatalf("got tokens %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got tokens %v, want %v", got, want)
+		}
+	}
+
+	errs := l.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+	if errs[0].Position.Column != 7 {
+		t.Fatalf("got error at column %d, want 7: %v", errs[0].Position.Column, errs[0])
+	}
+}